@@ -0,0 +1,107 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/concourse/concourse/atc/api/auth"
+)
+
+func TestGzipCookieCodecRoundTrip(t *testing.T) {
+	codec := auth.GzipCookieCodec{}
+
+	encoded, err := codec.Encode("some-bearer-token")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	decoded, err := codec.Decode(encoded)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if decoded != "some-bearer-token" {
+		t.Errorf("expected round-tripped value to match, got %q", decoded)
+	}
+}
+
+func TestGzipCookieCodecRejectsMalformedPayloadWithoutPanicking(t *testing.T) {
+	codec := auth.GzipCookieCodec{}
+
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("Decode panicked on malformed input: %v", r)
+		}
+	}()
+
+	if _, err := codec.Decode("not valid base64 or gzip!!!"); err != auth.ErrMalformedCookie {
+		t.Errorf("expected ErrMalformedCookie, got %v", err)
+	}
+}
+
+func TestGzipCookieCodecIsNotAuthenticated(t *testing.T) {
+	if (auth.GzipCookieCodec{}).Authenticated() {
+		t.Errorf("expected GzipCookieCodec to not be authenticated")
+	}
+}
+
+func TestHMACCookieCodecRoundTrip(t *testing.T) {
+	codec := auth.HMACCookieCodec{Key: []byte("super-secret-key")}
+
+	encoded, err := codec.Encode("some-bearer-token")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	decoded, err := codec.Decode(encoded)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if decoded != "some-bearer-token" {
+		t.Errorf("expected round-tripped value to match, got %q", decoded)
+	}
+}
+
+func TestHMACCookieCodecIsAuthenticated(t *testing.T) {
+	if !(auth.HMACCookieCodec{Key: []byte("k")}).Authenticated() {
+		t.Errorf("expected HMACCookieCodec to be authenticated")
+	}
+}
+
+func TestHMACCookieCodecRejectsTamperedPayloadWithoutPanicking(t *testing.T) {
+	codec := auth.HMACCookieCodec{Key: []byte("super-secret-key")}
+
+	encoded, err := codec.Encode("some-bearer-token")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tampered := encoded[:len(encoded)-4] + "AAAA"
+
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("Decode panicked on tampered input: %v", r)
+		}
+	}()
+
+	if _, err := codec.Decode(tampered); err != auth.ErrMalformedCookie {
+		t.Errorf("expected tampered cookie to be rejected with ErrMalformedCookie, got %v", err)
+	}
+}
+
+func TestHMACCookieCodecRejectsWrongKey(t *testing.T) {
+	encoded, err := (auth.HMACCookieCodec{Key: []byte("key-a")}).Encode("some-bearer-token")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := (auth.HMACCookieCodec{Key: []byte("key-b")}).Decode(encoded); err != auth.ErrMalformedCookie {
+		t.Errorf("expected a cookie signed with a different key to be rejected, got %v", err)
+	}
+}
+
+func TestRawCookieCodecIsNotAuthenticated(t *testing.T) {
+	if (auth.RawCookieCodec{}).Authenticated() {
+		t.Errorf("expected RawCookieCodec to not be authenticated")
+	}
+}
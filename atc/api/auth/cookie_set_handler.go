@@ -1,52 +1,137 @@
 package auth
 
 import (
-	"bytes"
-	"io/ioutil"
-	"context"
+	"log"
 	"net/http"
-	"encoding/base64"
-	"compress/gzip"
+	"time"
 )
 
+// AuthCookieName is the cookie the web UI stashes a bearer token in, for
+// browser requests that can't set an Authorization header directly.
+const AuthCookieName = "ATC-Authorization"
+
+// CookieOptions control the attributes applied to the auth cookie whenever
+// the ATC (re-)issues it.
+type CookieOptions struct {
+	Domain   string
+	Path     string
+	MaxAge   time.Duration
+	Secure   bool
+	HttpOnly bool
+	SameSite http.SameSite
+}
+
+// DefaultCookieOptions is a conservative baseline: scoped to the root path,
+// marked Secure and HttpOnly, and SameSite=Lax, so cross-site requests only
+// carry it on top-level navigations.
+var DefaultCookieOptions = CookieOptions{
+	Path:     "/",
+	Secure:   true,
+	HttpOnly: true,
+	SameSite: http.SameSiteLaxMode,
+}
+
+// CookieSetHandler bridges a bearer token found on the incoming request into
+// the Authorization header, for clients that can't set the header directly.
 type CookieSetHandler struct {
 	Handler http.Handler
+
+	// Codec decodes a token pulled from a cookie source. Defaults to
+	// GzipCookieCodec if nil. Tokens pulled from other sources (header,
+	// query, form) are used as-is.
+	Codec CookieCodec
+
+	// Production rejects non-authenticated codecs, both when issuing a cookie
+	// via SetAuthCookie and when ServeHTTP reads one (the cookie is then
+	// cleared and not trusted). Leave false only for local development.
+	Production bool
+
+	// Extractors locates the bearer token on the incoming request, tried in
+	// order until one succeeds. Defaults to a single
+	// cookie:AuthCookieName extractor.
+	Extractors TokenExtractorChain
 }
 
 func (handler CookieSetHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie(AuthCookieName)
-	if err == nil {
-		ctx := context.WithValue(r.Context(), CSRFRequiredKey, handler.isCSRFRequired(r))
-		r = r.WithContext(ctx)
+	if r.Header.Get("Authorization") == "" {
+		for _, extractor := range handler.extractors() {
+			token, ok := extractor.Extract(r)
+			if !ok {
+				continue
+			}
+
+			if _, fromCookie := extractor.(CookieTokenExtractor); fromCookie {
+				codec := handler.codec()
+				if handler.Production && !codec.Authenticated() {
+					log.Printf("refusing to trust %s cookie: codec %T does not authenticate its payload in production", AuthCookieName, codec)
+					clearAuthCookie(w)
+					break
+				}
+
+				decoded, err := codec.Decode(token)
+				if err != nil {
+					log.Printf("failed to decode %s cookie: %v", AuthCookieName, err)
+					clearAuthCookie(w)
+					break
+				}
+				token = decoded
+			}
 
-		if r.Header.Get("Authorization") == "" {
-			r.Header.Set("Authorization", decompress(cookie.Value))
+			r.Header.Set("Authorization", token)
+			break
 		}
 	}
 
 	handler.Handler.ServeHTTP(w, r)
 }
 
-func decompress(str string) string {
-	data, _ := base64.StdEncoding.DecodeString(str)
-	gz, err := gzip.NewReader(bytes.NewBuffer([]byte(data)))
-	if err != nil {
-		panic(err)
+func (handler CookieSetHandler) codec() CookieCodec {
+	if handler.Codec != nil {
+		return handler.Codec
 	}
-	decompressed, err := ioutil.ReadAll(gz)
-	if err != nil {
-		panic(err)
+	return GzipCookieCodec{}
+}
+
+func (handler CookieSetHandler) extractors() TokenExtractorChain {
+	if handler.Extractors != nil {
+		return handler.Extractors
 	}
-	return string(decompressed)
+	return TokenExtractorChain{CookieTokenExtractor{Name: AuthCookieName}}
 }
 
-// We don't validate CSRF token for GET requests
-// since they are not changing the state
-func (handler CookieSetHandler) isCSRFRequired(r *http.Request) bool {
-	return (r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions)
+// SetAuthCookie encodes value with handler.Codec and (re-)issues the auth
+// cookie with opts applied. It refuses to use a non-authenticated codec when
+// handler.Production is true.
+func (handler CookieSetHandler) SetAuthCookie(w http.ResponseWriter, value string, opts CookieOptions) error {
+	codec := handler.codec()
+	if handler.Production && !codec.Authenticated() {
+		return ErrUnauthenticatedCookieCodec
+	}
+
+	encoded, err := codec.Encode(value)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     AuthCookieName,
+		Value:    encoded,
+		Domain:   opts.Domain,
+		Path:     opts.Path,
+		MaxAge:   int(opts.MaxAge.Seconds()),
+		Secure:   opts.Secure,
+		HttpOnly: opts.HttpOnly,
+		SameSite: opts.SameSite,
+	})
+
+	return nil
 }
 
-func IsCSRFRequired(r *http.Request) bool {
-	required, ok := r.Context().Value(CSRFRequiredKey).(bool)
-	return ok && required
+func clearAuthCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:   AuthCookieName,
+		Value:  "",
+		Path:   "/",
+		MaxAge: -1,
+	})
 }
@@ -0,0 +1,351 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"net/http"
+	"path"
+)
+
+const (
+	// CSRFTokenLength is the size, in bytes, of the real (unmasked) CSRF
+	// token minted per session.
+	CSRFTokenLength = 32
+
+	csrfCookieName = "ATC-CSRF-Token"
+	csrfHeaderName = "X-CSRF-Token"
+	csrfFormField  = "csrf_token"
+)
+
+type csrfTokenKey struct{}
+type csrfSettingsKey struct{}
+
+// csrfSettings is threaded through the request context by CSRFProtect so
+// that RotateCSRFToken (called from a handler further down the chain, e.g.
+// login/logout or the rotate endpoint) issues a cookie with the same signing
+// codec and attributes CSRFProtect itself reads back.
+type csrfSettings struct {
+	codec         CookieCodec
+	cookieOptions CookieOptions
+}
+
+// Option configures CSRFProtect.
+type Option func(*csrfConfig)
+
+type csrfConfig struct {
+	exempt         []string
+	failureHandler http.Handler
+	tokenSources   TokenExtractorChain
+	codec          CookieCodec
+	cookieOptions  CookieOptions
+}
+
+// defaultCSRFTokenSources looks for the masked CSRF token in the
+// X-CSRF-Token header first, falling back to the csrf_token form field for
+// multipart form submissions that can't set custom headers.
+var defaultCSRFTokenSources = TokenExtractorChain{
+	HeaderTokenExtractor{Name: csrfHeaderName},
+	FormTokenExtractor{Name: csrfFormField},
+}
+
+// TokenSources overrides where CSRFProtect looks for the submitted CSRF
+// token, evaluated in order. Each spec has the form "source:name", as
+// accepted by ParseTokenExtractors. Panics on an invalid spec, as this is a
+// startup-time configuration error.
+func TokenSources(specs ...string) Option {
+	chain, err := ParseTokenExtractors(specs...)
+	if err != nil {
+		panic(err)
+	}
+	return func(c *csrfConfig) {
+		c.tokenSources = chain
+	}
+}
+
+// Exempt excludes requests whose path matches pattern (as interpreted by
+// path.Match) from CSRF verification. Use this for API routes that
+// authenticate with a bearer token rather than cookies, e.g. CI runners
+// using fly.
+func Exempt(pattern string) Option {
+	return func(c *csrfConfig) {
+		c.exempt = append(c.exempt, pattern)
+	}
+}
+
+// FailureHandler overrides the response written when CSRF verification
+// fails. It defaults to a plain 403 Forbidden.
+func FailureHandler(h http.Handler) Option {
+	return func(c *csrfConfig) {
+		c.failureHandler = h
+	}
+}
+
+// CSRFCookieOptions overrides the attributes applied to the ATC-CSRF-Token
+// cookie (Domain, Path, MaxAge, Secure, HttpOnly, SameSite). It defaults to
+// DefaultCookieOptions. Keep Secure true in production even behind a
+// TLS-terminating proxy/load balancer, since r.TLS is nil on the ATC process
+// in that case and can't be used to infer it.
+func CSRFCookieOptions(opts CookieOptions) Option {
+	return func(c *csrfConfig) {
+		c.cookieOptions = opts
+	}
+}
+
+// CSRFSigningKey authenticates the CSRF cookie with HMAC-SHA256 under key,
+// so a cookie "tossed" onto the domain by another origin that shares it
+// (a sibling subdomain, or any origin able to set cookies for the
+// registrable domain) can't be accepted as a valid session token. Set this
+// to a stable, shared key in any deployment running more than one ATC
+// process, since each process otherwise mints its own random key and will
+// reject cookies signed by its siblings.
+func CSRFSigningKey(key []byte) Option {
+	return func(c *csrfConfig) {
+		c.codec = HMACCookieCodec{Key: key}
+	}
+}
+
+func defaultFailureHandler(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "invalid or missing CSRF token", http.StatusForbidden)
+}
+
+// CSRFProtect wraps handler with CSRF verification for unsafe HTTP methods.
+//
+// A 32-byte token is minted per session and kept in an HMAC-signed cookie
+// (see CSRFSigningKey), so it can't be forged by cookie tossing from another
+// origin that shares the registrable domain. On every request that isn't
+// GET, HEAD, OPTIONS, or TRACE, the token carried in the X-CSRF-Token header
+// (or csrf_token form field) is unmasked and compared against the session
+// token with a constant-time comparison. Tokens handed to clients are masked
+// with a one-time pad (see maskToken) so that reflecting them back in a
+// response body can't be used as a BREACH compression oracle.
+func CSRFProtect(handler http.Handler, opts ...Option) http.Handler {
+	cfg := &csrfConfig{
+		cookieOptions: DefaultCookieOptions,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.failureHandler == nil {
+		cfg.failureHandler = http.HandlerFunc(defaultFailureHandler)
+	}
+	if cfg.tokenSources == nil {
+		cfg.tokenSources = defaultCSRFTokenSources
+	}
+	if cfg.codec == nil {
+		key := make([]byte, CSRFTokenLength)
+		if _, err := rand.Read(key); err != nil {
+			panic(err)
+		}
+		cfg.codec = HMACCookieCodec{Key: key}
+	}
+
+	settings := &csrfSettings{
+		codec:         cfg.codec,
+		cookieOptions: cfg.cookieOptions,
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(context.WithValue(r.Context(), csrfSettingsKey{}, settings))
+
+		realToken, err := ensureCSRFToken(w, r, settings)
+		if err != nil {
+			cfg.failureHandler.ServeHTTP(w, r)
+			return
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), csrfTokenKey{}, realToken))
+
+		if requiresCSRFCheck(r) && !csrfExempt(r.URL.Path, cfg.exempt) {
+			if !validCSRFToken(r, realToken, cfg.tokenSources) {
+				cfg.failureHandler.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func requiresCSRFCheck(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	default:
+		return true
+	}
+}
+
+func csrfExempt(requestPath string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, requestPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureCSRFToken returns the real (unmasked) per-session CSRF token,
+// minting and persisting one in a signed cookie if none exists yet, or if
+// the existing cookie fails to authenticate.
+func ensureCSRFToken(w http.ResponseWriter, r *http.Request, settings *csrfSettings) ([]byte, error) {
+	if cookie, err := r.Cookie(csrfCookieName); err == nil {
+		if token, ok := decodeCSRFCookie(settings.codec, cookie.Value); ok {
+			return token, nil
+		}
+	}
+
+	return issueCSRFToken(w, r, settings)
+}
+
+func decodeCSRFCookie(codec CookieCodec, value string) ([]byte, bool) {
+	decoded, err := codec.Decode(value)
+	if err != nil {
+		return nil, false
+	}
+
+	token, err := base64.StdEncoding.DecodeString(decoded)
+	if err != nil || len(token) != CSRFTokenLength {
+		return nil, false
+	}
+
+	return token, true
+}
+
+func issueCSRFToken(w http.ResponseWriter, r *http.Request, settings *csrfSettings) ([]byte, error) {
+	token := make([]byte, CSRFTokenLength)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+
+	encoded, err := settings.codec.Encode(base64.StdEncoding.EncodeToString(token))
+	if err != nil {
+		return nil, err
+	}
+
+	opts := settings.cookieOptions
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    encoded,
+		Domain:   opts.Domain,
+		Path:     opts.Path,
+		MaxAge:   int(opts.MaxAge.Seconds()),
+		Secure:   opts.Secure,
+		HttpOnly: opts.HttpOnly,
+		SameSite: opts.SameSite,
+	})
+
+	return token, nil
+}
+
+var errCSRFNotProtected = errors.New("request did not pass through CSRFProtect")
+
+// RotateCSRFToken invalidates the caller's current per-session CSRF token
+// and mints a fresh one, persisting it via the same signed cookie
+// CSRFProtect reads. Callers should invoke this on login, logout, and in
+// response to an explicit rotation request, so a token from a previous
+// session can never be replayed. The request must have already passed
+// through CSRFProtect, which is where the cookie's signing codec and
+// attributes come from.
+func RotateCSRFToken(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	settings, ok := r.Context().Value(csrfSettingsKey{}).(*csrfSettings)
+	if !ok {
+		return nil, errCSRFNotProtected
+	}
+
+	return issueCSRFToken(w, r, settings)
+}
+
+// validCSRFToken reports whether the masked token produced by sources
+// unmasks to realToken.
+func validCSRFToken(r *http.Request, realToken []byte, sources TokenExtractorChain) bool {
+	issued, ok := sources.Extract(r)
+	if !ok {
+		return false
+	}
+
+	submitted, err := unmaskToken(issued)
+	if err != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(submitted, realToken) == 1
+}
+
+// maskToken XORs token with a fresh one-time pad and returns
+// base64(pad || masked), so that the same real token never produces the same
+// byte string twice in a response body.
+func maskToken(token []byte) (string, error) {
+	pad := make([]byte, len(token))
+	if _, err := rand.Read(pad); err != nil {
+		return "", err
+	}
+
+	masked := make([]byte, len(token))
+	for i := range token {
+		masked[i] = token[i] ^ pad[i]
+	}
+
+	return base64.StdEncoding.EncodeToString(append(pad, masked...)), nil
+}
+
+// unmaskToken reverses maskToken.
+func unmaskToken(issued string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(issued)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%2 != 0 {
+		return nil, errInvalidCSRFToken
+	}
+
+	half := len(data) / 2
+	pad, masked := data[:half], data[half:]
+
+	token := make([]byte, half)
+	for i := range token {
+		token[i] = pad[i] ^ masked[i]
+	}
+
+	return token, nil
+}
+
+var errInvalidCSRFToken = errors.New("invalid csrf token encoding")
+
+// CSRFToken returns a freshly masked CSRF token for use in the current
+// request/response, for handlers serving HTML forms or bootstrapping the web
+// UI. It must be called from within a handler wrapped by CSRFProtect.
+func CSRFToken(r *http.Request) (string, error) {
+	token, _ := r.Context().Value(csrfTokenKey{}).([]byte)
+	if token == nil {
+		return "", errCSRFNotProtected
+	}
+	return maskToken(token)
+}
+
+// CSRFTemplateField renders a hidden form field carrying the masked CSRF
+// token, for use in Go html/template views.
+func CSRFTemplateField(r *http.Request) template.HTML {
+	token, err := CSRFToken(r)
+	if err != nil {
+		return ""
+	}
+	return template.HTML(`<input type="hidden" name="` + csrfFormField + `" value="` + token + `">`)
+}
+
+// StampCSRFToken wraps handler so that every response carries a freshly
+// masked CSRF token in the X-CSRF-Token response header, letting clients
+// like the Elm web UI pick up a token without a dedicated round-trip. It
+// must run inside CSRFProtect, so a per-session token is already on the
+// request context.
+func StampCSRFToken(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token, err := CSRFToken(r); err == nil {
+			w.Header().Set(csrfHeaderName, token)
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMaskTokenRoundTrip(t *testing.T) {
+	token := bytes.Repeat([]byte{0x42}, CSRFTokenLength)
+
+	masked, err := maskToken(token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	unmasked, err := unmaskToken(masked)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !bytes.Equal(unmasked, token) {
+		t.Errorf("expected unmasked token to equal original, got %x want %x", unmasked, token)
+	}
+}
+
+func TestMaskTokenProducesDifferentCiphertexts(t *testing.T) {
+	token := make([]byte, CSRFTokenLength)
+
+	a, err := maskToken(token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	b, err := maskToken(token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if a == b {
+		t.Errorf("expected two maskings of the same token to differ (BREACH mitigation), got %q twice", a)
+	}
+}
+
+func TestUnmaskTokenRejectsMalformedInput(t *testing.T) {
+	if _, err := unmaskToken("not-base64!!!"); err == nil {
+		t.Errorf("expected an error for invalid base64")
+	}
+
+	if _, err := unmaskToken("AQ=="); err == nil {
+		t.Errorf("expected an error for an odd-length payload")
+	}
+}
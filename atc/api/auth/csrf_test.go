@@ -0,0 +1,203 @@
+package auth_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/concourse/concourse/atc/api/auth"
+)
+
+func TestCSRFProtectAllowsSafeMethodsWithoutToken(t *testing.T) {
+	server := httptest.NewServer(auth.CSRFProtect(okHandler()))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected GET to be allowed without a token, got %d", resp.StatusCode)
+	}
+}
+
+func TestCSRFProtectRejectsUnsafeMethodWithoutToken(t *testing.T) {
+	server := httptest.NewTLSServer(auth.CSRFProtect(okHandler()))
+	defer server.Close()
+
+	client := sessionClient(t, server)
+	primeSession(t, client, server.URL)
+
+	resp, err := client.Post(server.URL, "application/x-www-form-urlencoded", strings.NewReader(""))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected POST without a token to be forbidden, got %d", resp.StatusCode)
+	}
+}
+
+func TestCSRFProtectRejectsWrongToken(t *testing.T) {
+	server := httptest.NewTLSServer(auth.CSRFProtect(okHandler()))
+	defer server.Close()
+
+	client := sessionClient(t, server)
+	primeSession(t, client, server.URL)
+
+	req, _ := http.NewRequest("POST", server.URL, strings.NewReader(""))
+	req.Header.Set("X-CSRF-Token", "bm9wZW5vcGVub3Blbm9wZW5vcGVub3Blbm9wZW5vcGVub3Blbm9wZW5vcGVub3Blbg==")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected POST with a bogus token to be forbidden, got %d", resp.StatusCode)
+	}
+}
+
+func TestCSRFProtectAllowsUnsafeMethodWithValidToken(t *testing.T) {
+	var capturedToken string
+	handler := auth.CSRFProtect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			token, err := auth.CSRFToken(r)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			capturedToken = token
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	server := httptest.NewTLSServer(handler)
+	defer server.Close()
+
+	client := sessionClient(t, server)
+	primeSession(t, client, server.URL)
+
+	req, _ := http.NewRequest("POST", server.URL, strings.NewReader(""))
+	req.Header.Set("X-CSRF-Token", capturedToken)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected POST with the token handed out for this session to succeed, got %d", resp.StatusCode)
+	}
+}
+
+func TestCSRFProtectRejectsTossedCookie(t *testing.T) {
+	var attackerToken string
+	attacker := httptest.NewTLSServer(auth.CSRFProtect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := auth.CSRFToken(r)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		attackerToken = token
+		w.WriteHeader(http.StatusOK)
+	})))
+	defer attacker.Close()
+
+	victim := httptest.NewTLSServer(auth.CSRFProtect(okHandler()))
+	defer victim.Close()
+
+	client := sessionClient(t, attacker)
+
+	// Mint a real, validly-signed cookie and a masked token matching it, but
+	// from a different CSRFProtect instance (standing in for a sibling origin
+	// forging its own cookie for the shared domain), so only the cookie's
+	// signature can cause the rejection.
+	primeSession(t, client, attacker.URL)
+	attackerCookies := client.Jar.Cookies(mustParseURL(t, attacker.URL))
+
+	req, err := http.NewRequest("POST", victim.URL, strings.NewReader(""))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, cookie := range attackerCookies {
+		req.AddCookie(cookie)
+	}
+	req.Header.Set("X-CSRF-Token", attackerToken)
+
+	resp, err := victim.Client().Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected a cookie signed by a different CSRFProtect instance to be rejected, got %d", resp.StatusCode)
+	}
+}
+
+func TestCSRFProtectExemptPathSkipsVerification(t *testing.T) {
+	server := httptest.NewServer(auth.CSRFProtect(okHandler(), auth.Exempt("/webhooks/*")))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/webhooks/github", "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected an exempt path to skip CSRF verification, got %d", resp.StatusCode)
+	}
+}
+
+func okHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// sessionClient returns server's preconfigured (TLS-trusting) client with a
+// cookie jar attached, so the ATC-CSRF-Token cookie — marked Secure by
+// DefaultCookieOptions — is actually persisted across requests.
+func sessionClient(t *testing.T, server *httptest.Server) *http.Client {
+	t.Helper()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	client := server.Client()
+	client.Jar = jar
+	return client
+}
+
+func primeSession(t *testing.T, client *http.Client, serverURL string) {
+	t.Helper()
+
+	resp, err := client.Get(serverURL)
+	if err != nil {
+		t.Fatalf("unexpected error priming session: %v", err)
+	}
+	defer resp.Body.Close()
+
+	ioutil.ReadAll(resp.Body)
+}
+
+func mustParseURL(t *testing.T, rawURL string) *url.URL {
+	t.Helper()
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return parsed
+}
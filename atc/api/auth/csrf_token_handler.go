@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// CSRFTokenHandler serves GET /api/v1/user/csrf-token, handing back the
+// current session's masked CSRF token so the web UI can attach it to
+// subsequent requests without parsing it out of an HTML template.
+type CSRFTokenHandler struct{}
+
+func (CSRFTokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, err := CSRFToken(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeCSRFTokenResponse(w, token)
+}
+
+// CSRFTokenRotateHandler serves POST /api/v1/user/csrf-token/rotate,
+// invalidating the caller's current CSRF token and issuing a new one.
+type CSRFTokenRotateHandler struct{}
+
+func (CSRFTokenRotateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	realToken, err := RotateCSRFToken(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	token, err := maskToken(realToken)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeCSRFTokenResponse(w, token)
+}
+
+type csrfTokenResponse struct {
+	CSRFToken string `json:"csrf_token"`
+}
+
+func writeCSRFTokenResponse(w http.ResponseWriter, token string) {
+	w.Header().Set(csrfHeaderName, token)
+	w.Header().Set("Content-Type", "application/json")
+	// The token is a bearer-equivalent secret for the session; don't let
+	// intermediary caches or the back-forward cache retain it.
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(csrfTokenResponse{CSRFToken: token})
+}
@@ -0,0 +1,125 @@
+package auth_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/concourse/concourse/atc/api/auth"
+)
+
+type csrfTokenResponseBody struct {
+	CSRFToken string `json:"csrf_token"`
+}
+
+func TestCSRFTokenHandlerReturnsMaskedToken(t *testing.T) {
+	server := httptest.NewServer(auth.CSRFProtect(auth.CSRFTokenHandler{}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	if resp.Header.Get("Cache-Control") != "no-store" {
+		t.Errorf("expected Cache-Control: no-store, got %q", resp.Header.Get("Cache-Control"))
+	}
+
+	if resp.Header.Get("X-CSRF-Token") == "" {
+		t.Errorf("expected an X-CSRF-Token response header")
+	}
+
+	var body csrfTokenResponseBody
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("unexpected error decoding response: %v", err)
+	}
+
+	if body.CSRFToken == "" {
+		t.Errorf("expected a non-empty csrf_token in the response body")
+	}
+}
+
+func TestCSRFTokenHandlerFailsWithoutCSRFProtect(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/v1/user/csrf-token", nil)
+	rec := httptest.NewRecorder()
+
+	auth.CSRFTokenHandler{}.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500 when not wrapped by CSRFProtect, got %d", rec.Code)
+	}
+}
+
+func TestCSRFTokenRotateHandlerIssuesFreshTokenAndSetsNoStore(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/rotate" {
+			auth.CSRFTokenRotateHandler{}.ServeHTTP(w, r)
+			return
+		}
+		auth.CSRFTokenHandler{}.ServeHTTP(w, r)
+	})
+
+	server := httptest.NewTLSServer(auth.CSRFProtect(handler))
+	defer server.Close()
+
+	client := sessionClient(t, server)
+
+	before, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var beforeBody csrfTokenResponseBody
+	if err := json.NewDecoder(before.Body).Decode(&beforeBody); err != nil {
+		t.Fatalf("unexpected error decoding response: %v", err)
+	}
+	before.Body.Close()
+
+	req, err := http.NewRequest("POST", server.URL+"/rotate", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req.Header.Set("X-CSRF-Token", beforeBody.CSRFToken)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	if resp.Header.Get("Cache-Control") != "no-store" {
+		t.Errorf("expected Cache-Control: no-store, got %q", resp.Header.Get("Cache-Control"))
+	}
+
+	var afterBody csrfTokenResponseBody
+	if err := json.NewDecoder(resp.Body).Decode(&afterBody); err != nil {
+		t.Fatalf("unexpected error decoding response: %v", err)
+	}
+
+	if afterBody.CSRFToken == "" {
+		t.Errorf("expected a non-empty csrf_token in the rotate response")
+	}
+	if afterBody.CSRFToken == beforeBody.CSRFToken {
+		t.Errorf("expected rotate to hand back a freshly masked token")
+	}
+}
+
+func TestCSRFTokenRotateHandlerFailsWithoutCSRFProtect(t *testing.T) {
+	req := httptest.NewRequest("POST", "/api/v1/user/csrf-token/rotate", nil)
+	rec := httptest.NewRecorder()
+
+	auth.CSRFTokenRotateHandler{}.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500 when not wrapped by CSRFProtect, got %d", rec.Code)
+	}
+}
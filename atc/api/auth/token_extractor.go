@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TokenExtractor pulls a candidate token (bearer or CSRF) off an incoming
+// request.
+type TokenExtractor interface {
+	Extract(r *http.Request) (string, bool)
+}
+
+// TokenExtractorChain tries a sequence of TokenExtractors in order,
+// returning the first token any of them produce.
+type TokenExtractorChain []TokenExtractor
+
+func (chain TokenExtractorChain) Extract(r *http.Request) (string, bool) {
+	for _, extractor := range chain {
+		if token, ok := extractor.Extract(r); ok {
+			return token, true
+		}
+	}
+	return "", false
+}
+
+// ParseTokenExtractors builds a TokenExtractorChain from specs of the form
+// "source:name", e.g. "header:Authorization", "cookie:ATC-Authorization",
+// "query:access_token", or "form:csrf_token".
+func ParseTokenExtractors(specs ...string) (TokenExtractorChain, error) {
+	chain := make(TokenExtractorChain, len(specs))
+	for i, spec := range specs {
+		extractor, err := parseTokenExtractor(spec)
+		if err != nil {
+			return nil, err
+		}
+		chain[i] = extractor
+	}
+	return chain, nil
+}
+
+func parseTokenExtractor(spec string) (TokenExtractor, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("invalid token extractor %q: want \"source:name\"", spec)
+	}
+
+	source, name := parts[0], parts[1]
+
+	switch source {
+	case "header":
+		return HeaderTokenExtractor{Name: name}, nil
+	case "cookie":
+		return CookieTokenExtractor{Name: name}, nil
+	case "query":
+		return QueryTokenExtractor{Name: name}, nil
+	case "form":
+		return FormTokenExtractor{Name: name}, nil
+	default:
+		return nil, fmt.Errorf("invalid token extractor %q: unknown source %q", spec, source)
+	}
+}
+
+// HeaderTokenExtractor extracts a token from a request header.
+type HeaderTokenExtractor struct {
+	Name string
+}
+
+func (e HeaderTokenExtractor) Extract(r *http.Request) (string, bool) {
+	value := r.Header.Get(e.Name)
+	return value, value != ""
+}
+
+// CookieTokenExtractor extracts a token from a cookie.
+type CookieTokenExtractor struct {
+	Name string
+}
+
+func (e CookieTokenExtractor) Extract(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(e.Name)
+	if err != nil {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
+// QueryTokenExtractor extracts a token from a URL query parameter, for API
+// clients that can't set cookies or custom headers.
+type QueryTokenExtractor struct {
+	Name string
+}
+
+func (e QueryTokenExtractor) Extract(r *http.Request) (string, bool) {
+	value := r.URL.Query().Get(e.Name)
+	return value, value != ""
+}
+
+// FormTokenExtractor extracts a token from a form field, posted either as
+// application/x-www-form-urlencoded or multipart/form-data.
+type FormTokenExtractor struct {
+	Name string
+}
+
+func (e FormTokenExtractor) Extract(r *http.Request) (string, bool) {
+	value := r.PostFormValue(e.Name)
+	return value, value != ""
+}
@@ -0,0 +1,135 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/concourse/concourse/atc/api/auth"
+)
+
+func TestHeaderTokenExtractor(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer some-token")
+
+	extractor := auth.HeaderTokenExtractor{Name: "Authorization"}
+
+	token, ok := extractor.Extract(r)
+	if !ok || token != "Bearer some-token" {
+		t.Errorf("expected to extract header token, got %q, %v", token, ok)
+	}
+
+	empty, _ := http.NewRequest("GET", "/", nil)
+	if _, ok := extractor.Extract(empty); ok {
+		t.Errorf("expected no token when header is absent")
+	}
+}
+
+func TestCookieTokenExtractor(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "ATC-Authorization", Value: "cookie-token"})
+
+	extractor := auth.CookieTokenExtractor{Name: "ATC-Authorization"}
+
+	token, ok := extractor.Extract(r)
+	if !ok || token != "cookie-token" {
+		t.Errorf("expected to extract cookie token, got %q, %v", token, ok)
+	}
+
+	empty, _ := http.NewRequest("GET", "/", nil)
+	if _, ok := extractor.Extract(empty); ok {
+		t.Errorf("expected no token when cookie is absent")
+	}
+}
+
+func TestQueryTokenExtractor(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/?access_token=query-token", nil)
+
+	extractor := auth.QueryTokenExtractor{Name: "access_token"}
+
+	token, ok := extractor.Extract(r)
+	if !ok || token != "query-token" {
+		t.Errorf("expected to extract query token, got %q, %v", token, ok)
+	}
+
+	empty, _ := http.NewRequest("GET", "/", nil)
+	if _, ok := extractor.Extract(empty); ok {
+		t.Errorf("expected no token when query param is absent")
+	}
+}
+
+func TestFormTokenExtractor(t *testing.T) {
+	r, _ := http.NewRequest("POST", "/", strings.NewReader(url.Values{
+		"csrf_token": {"form-token"},
+	}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	extractor := auth.FormTokenExtractor{Name: "csrf_token"}
+
+	token, ok := extractor.Extract(r)
+	if !ok || token != "form-token" {
+		t.Errorf("expected to extract form token, got %q, %v", token, ok)
+	}
+
+	empty, _ := http.NewRequest("POST", "/", nil)
+	if _, ok := extractor.Extract(empty); ok {
+		t.Errorf("expected no token when form field is absent")
+	}
+}
+
+func TestTokenExtractorChainReturnsFirstMatch(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/?access_token=query-token", nil)
+	r.AddCookie(&http.Cookie{Name: "ATC-Authorization", Value: "cookie-token"})
+
+	chain := auth.TokenExtractorChain{
+		auth.HeaderTokenExtractor{Name: "Authorization"},
+		auth.CookieTokenExtractor{Name: "ATC-Authorization"},
+		auth.QueryTokenExtractor{Name: "access_token"},
+	}
+
+	token, ok := chain.Extract(r)
+	if !ok || token != "cookie-token" {
+		t.Errorf("expected chain to return first match (cookie), got %q, %v", token, ok)
+	}
+}
+
+func TestParseTokenExtractors(t *testing.T) {
+	chain, err := auth.ParseTokenExtractors(
+		"header:Authorization",
+		"cookie:ATC-Authorization",
+		"query:access_token",
+		"form:csrf_token",
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(chain) != 4 {
+		t.Fatalf("expected 4 extractors, got %d", len(chain))
+	}
+
+	if _, ok := chain[0].(auth.HeaderTokenExtractor); !ok {
+		t.Errorf("expected chain[0] to be a HeaderTokenExtractor")
+	}
+	if _, ok := chain[1].(auth.CookieTokenExtractor); !ok {
+		t.Errorf("expected chain[1] to be a CookieTokenExtractor")
+	}
+	if _, ok := chain[2].(auth.QueryTokenExtractor); !ok {
+		t.Errorf("expected chain[2] to be a QueryTokenExtractor")
+	}
+	if _, ok := chain[3].(auth.FormTokenExtractor); !ok {
+		t.Errorf("expected chain[3] to be a FormTokenExtractor")
+	}
+}
+
+func TestParseTokenExtractorsRejectsUnknownSource(t *testing.T) {
+	if _, err := auth.ParseTokenExtractors("bogus:name"); err == nil {
+		t.Errorf("expected an error for an unknown source")
+	}
+}
+
+func TestParseTokenExtractorsRejectsMalformedSpec(t *testing.T) {
+	if _, err := auth.ParseTokenExtractors("header"); err == nil {
+		t.Errorf("expected an error for a spec without a name")
+	}
+}